@@ -0,0 +1,411 @@
+package geerpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/codec"
+)
+
+// Call represents an active RPC.
+type Call struct {
+	Seq           uint64
+	ServiceMethod string      // format "Service.Method"
+	Args          interface{} // arguments to the function
+	Reply         interface{} // reply from the function
+	Error         error       // if error occurs, it will be set
+	Done          chan *Call  // strobes when call is complete.
+}
+
+// done notifies the caller that this call is complete.
+func (call *Call) done() {
+	call.Done <- call
+}
+
+// Client represents an RPC Client.
+// There may be multiple outstanding Calls associated
+// with a single Client, and a Client may be used by
+// multiple goroutines simultaneously.
+type Client struct {
+	cc      codec.Codec
+	opt     *Option
+	sending sync.Mutex   // protects following, and serializes sends like serveCodec does on the server.
+	header  codec.Header // header is only used in sending, guarded by sending.
+
+	mu       sync.Mutex
+	seq      uint64
+	pending  map[uint64]*Call
+	streams  map[uint64]*streamSink // seq -> in-flight StreamGo call, disjoint from pending
+	closing  bool // user has called Close
+	shutdown bool // server has told us to stop
+}
+
+// streamSink is where dispatchStreamFrame delivers decoded frames for one
+// outstanding StreamGo call.
+type streamSink struct {
+	chanVal  reflect.Value
+	elemType reflect.Type
+}
+
+var _ io.Closer = (*Client)(nil)
+
+// ErrShutdown is returned once the client or the server has closed the
+// connection; no further calls can be made.
+var ErrShutdown = errors.New("rpc client: connection is shut down")
+
+// Close closes the underlying connection.
+func (client *Client) Close() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.closing {
+		return ErrShutdown
+	}
+	client.closing = true
+	return client.cc.Close()
+}
+
+// IsAvailable returns true if the client is still able to make calls.
+func (client *Client) IsAvailable() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return !client.shutdown && !client.closing
+}
+
+func (client *Client) registerCall(call *Call) (uint64, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.closing || client.shutdown {
+		return 0, ErrShutdown
+	}
+	call.Seq = client.seq
+	client.pending[call.Seq] = call
+	client.seq++
+	return call.Seq, nil
+}
+
+func (client *Client) removeCall(seq uint64) *Call {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	call := client.pending[seq]
+	delete(client.pending, seq)
+	return call
+}
+
+// terminateCalls is called when the connection's receive loop dies; it
+// fails every pending call so no caller of Call/Go blocks forever.
+func (client *Client) terminateCalls(err error) {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.shutdown = true
+	for _, call := range client.pending {
+		call.Error = err
+		call.done()
+	}
+	for seq, sink := range client.streams {
+		sink.chanVal.Close()
+		delete(client.streams, seq)
+	}
+}
+
+// receive reads headers off the wire for the client's lifetime and
+// dispatches each reply to its matching pending Call.
+func (client *Client) receive() {
+	var err error
+	for err == nil {
+		var h codec.Header
+		if err = client.cc.ReadHeader(&h); err != nil {
+			break
+		}
+		if h.Flag&codec.FlagStream != 0 {
+			err = client.dispatchStreamFrame(&h)
+			continue
+		}
+		call := client.removeCall(h.Seq)
+		switch {
+		case call == nil:
+			// Write partially failed and call was already removed.
+			err = client.cc.ReadBody(nil)
+		case h.Error != "":
+			call.Error = fmt.Errorf(h.Error)
+			err = client.cc.ReadBody(nil)
+			call.done()
+		default:
+			err = client.cc.ReadBody(call.Reply)
+			if err != nil {
+				call.Error = errors.New("rpc client: reading body " + err.Error())
+			}
+			call.done()
+		}
+	}
+	// Error occurs, terminate all pending calls.
+	client.terminateCalls(err)
+}
+
+// dispatchStreamFrame routes one streaming frame to its StreamGo channel,
+// decoding the body only when a live sink is still registered for h.Seq,
+// and closes that channel once FlagEOS arrives.
+func (client *Client) dispatchStreamFrame(h *codec.Header) error {
+	client.mu.Lock()
+	sink, ok := client.streams[h.Seq]
+	if h.Flag&codec.FlagEOS != 0 {
+		delete(client.streams, h.Seq)
+	}
+	client.mu.Unlock()
+
+	if h.Flag&(codec.FlagEOS|codec.FlagError) != 0 {
+		err := client.cc.ReadBody(nil)
+		if ok {
+			sink.chanVal.Close()
+		}
+		return err
+	}
+	if !ok {
+		return client.cc.ReadBody(nil)
+	}
+
+	decodeTarget, sendVal := newStreamElem(sink.elemType)
+	if err := client.cc.ReadBody(decodeTarget.Interface()); err != nil {
+		return err
+	}
+	sink.chanVal.Send(sendVal)
+	return nil
+}
+
+// newStreamElem allocates a value to decode one stream frame's body into,
+// handling both chan T and chan *T the same way methodType.newArgs does
+// for ordinary calls.
+func newStreamElem(elemType reflect.Type) (decodeTarget, sendVal reflect.Value) {
+	if elemType.Kind() == reflect.Ptr {
+		v := reflect.New(elemType.Elem())
+		return v, v
+	}
+	v := reflect.New(elemType)
+	return v, v.Elem()
+}
+
+func (client *Client) registerStream() (uint64, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.closing || client.shutdown {
+		return 0, ErrShutdown
+	}
+	seq := client.seq
+	client.seq++
+	return seq, nil
+}
+
+// StreamGo invokes a streaming RPC asynchronously: replyChan must be a
+// channel (e.g. chan *Foo) matching the server method's per-frame reply
+// type. Every frame the server sends is decoded and delivered on
+// replyChan, which StreamGo closes once the stream ends.
+func (client *Client) StreamGo(serviceMethod string, args interface{}, replyChan interface{}) error {
+	chanVal := reflect.ValueOf(replyChan)
+	if chanVal.Kind() != reflect.Chan {
+		return errors.New("rpc client: StreamGo requires a channel for replyChan")
+	}
+
+	seq, err := client.registerStream()
+	if err != nil {
+		return err
+	}
+	sink := &streamSink{chanVal: chanVal, elemType: chanVal.Type().Elem()}
+	client.mu.Lock()
+	client.streams[seq] = sink
+	client.mu.Unlock()
+
+	client.sending.Lock()
+	h := codec.Header{ServiceMethod: serviceMethod, Seq: seq}
+	err = client.cc.Write(&h, args)
+	client.sending.Unlock()
+	if err != nil {
+		client.mu.Lock()
+		delete(client.streams, seq)
+		client.mu.Unlock()
+		sink.chanVal.Close()
+		return err
+	}
+	return nil
+}
+
+// NewClient negotiates the Option handshake over conn, then wires up the
+// chosen codec and starts receive().
+func NewClient(conn net.Conn, opt *Option) (*Client, error) {
+	f := codec.NewCodecFuncMap[opt.CodecType]
+	if f == nil {
+		err := fmt.Errorf("rpc client: invalid codec type %s", opt.CodecType)
+		log.Println("rpc client: codec error:", err)
+		return nil, err
+	}
+	if err := json.NewEncoder(conn).Encode(opt); err != nil {
+		log.Println("rpc client: options error:", err)
+		_ = conn.Close()
+		return nil, err
+	}
+	return newClientCodec(f(conn), opt), nil
+}
+
+func newClientCodec(cc codec.Codec, opt *Option) *Client {
+	client := &Client{
+		seq:     1, // seq starts at 1, 0 means invalid call.
+		cc:      cc,
+		opt:     opt,
+		pending: make(map[uint64]*Call),
+		streams: make(map[uint64]*streamSink),
+	}
+	go client.receive()
+	return client
+}
+
+// parseOptions returns DefaultOption when no *Option is given; otherwise
+// it sets MagicNumber and an empty CodecType from DefaultOption and
+// leaves the other fields (a zero ConnectTimeout means no limit) as given.
+func parseOptions(opts ...*Option) (*Option, error) {
+	if len(opts) == 0 || opts[0] == nil {
+		return DefaultOption, nil
+	}
+	if len(opts) != 1 {
+		return nil, errors.New("rpc client: number of options is more than 1")
+	}
+	opt := opts[0]
+	opt.MagicNumber = DefaultOption.MagicNumber
+	if opt.CodecType == "" {
+		opt.CodecType = DefaultOption.CodecType
+	}
+	return opt, nil
+}
+
+type clientResult struct {
+	client *Client
+	err    error
+}
+
+type newClientFunc func(conn net.Conn, opt *Option) (client *Client, err error)
+
+// dialTimeout dials address, then runs f (NewClient or NewHTTPClient) on a
+// goroutine so the handshake itself is bounded by opt.ConnectTimeout.
+func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (client *Client, err error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout(network, address, opt.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+	ch := make(chan clientResult)
+	go func() {
+		client, err := f(conn, opt)
+		ch <- clientResult{client: client, err: err}
+	}()
+	if opt.ConnectTimeout == 0 {
+		result := <-ch
+		return result.client, result.err
+	}
+	select {
+	case <-time.After(opt.ConnectTimeout):
+		return nil, fmt.Errorf("rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
+	case result := <-ch:
+		return result.client, result.err
+	}
+}
+
+// Dial connects to an RPC server at the specified network address.
+func Dial(network, address string, opts ...*Option) (*Client, error) {
+	return dialTimeout(NewClient, network, address, opts...)
+}
+
+// NewHTTPClient negotiates a CONNECT handshake at defaultRPCPath before
+// handing the hijacked connection to NewClient, the counterpart to
+// Server.ServeHTTP.
+func NewHTTPClient(conn net.Conn, opt *Option) (*Client, error) {
+	_, _ = io.WriteString(conn, fmt.Sprintf("CONNECT %s HTTP/1.0\n\n", defaultRPCPath))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status == connected {
+		return NewClient(conn, opt)
+	}
+	if err == nil {
+		err = errors.New("rpc client: unexpected HTTP response: " + resp.Status)
+	}
+	return nil, err
+}
+
+// DialHTTP connects to an RPC server listening on the default HTTP RPC
+// path, as registered by Server.HandleHTTP.
+func DialHTTP(network, address string, opts ...*Option) (*Client, error) {
+	return dialTimeout(NewHTTPClient, network, address, opts...)
+}
+
+// Call invokes the named function, waits for it to complete or for ctx to
+// be done, and returns its error status.
+func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	select {
+	case <-ctx.Done():
+		client.removeCall(call.Seq)
+		return errors.New("rpc client: call failed: " + ctx.Err().Error())
+	case call := <-call.Done:
+		return call.Error
+	}
+}
+
+// Go invokes the function asynchronously, returning the Call so the
+// caller can wait on call.Done itself instead of blocking here.
+func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 10)
+	} else if cap(done) == 0 {
+		log.Panic("rpc client: done channel is unbuffered")
+	}
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          done,
+	}
+	client.send(call)
+	return call
+}
+
+func (client *Client) send(call *Call) {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+
+	seq, err := client.registerCall(call)
+	if err != nil {
+		call.Error = err
+		call.done()
+		return
+	}
+
+	client.header.ServiceMethod = call.ServiceMethod
+	client.header.Seq = seq
+	client.header.Error = ""
+
+	if err := client.cc.Write(&client.header, call.Args); err != nil {
+		call := client.removeCall(seq)
+		// call may be nil, it usually means that Write partially
+		// failed, client has received the response and handled.
+		if call != nil {
+			call.Error = err
+			call.done()
+		}
+	}
+}
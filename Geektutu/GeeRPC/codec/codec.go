@@ -19,8 +19,25 @@ type Header struct {
 	ServiceMethod 	string // format "Service.Method"
 	Seq				uint64 // sequence number chosen by client.
 	Error			string // rpc server error info.
+	Flag			Flag   // set on streaming RPCs; zero for an ordinary call/reply.
 }
 
+// Flag marks a Header as part of a streaming RPC rather than an ordinary
+// single request/response pair.
+type Flag uint8
+
+const (
+	// FlagStream marks a frame as belonging to a streaming RPC; it may
+	// be combined with FlagEOS and/or FlagError on the final frame.
+	FlagStream Flag = 1 << iota
+	// FlagEOS marks the final frame of a stream; nothing more will be
+	// sent for this Header.Seq.
+	FlagEOS
+	// FlagError marks a stream's final frame as carrying an error in
+	// Header.Error instead of a reply.
+	FlagError
+)
+
 type NewCodecFunc func(io.ReadWriteCloser) Codec
 
 // Different encoding and decoding methods.
@@ -29,7 +46,7 @@ type Type string
 
 const (
 	GobType  Type = "application/gob"
-	JsonType Type = "application/json" // not implemented.
+	JsonType Type = "application/json"
 )
 
 var NewCodecFuncMap map[Type]NewCodecFunc
@@ -38,7 +55,6 @@ var NewCodecFuncMap map[Type]NewCodecFunc
 func init() {
 	NewCodecFuncMap = make(map[Type]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec
-	// TODO
-	// NewCodecFuncMap[JsonType] = NewJsonCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
 }
 
@@ -0,0 +1,141 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// jsonRequest is the wire shape of a JSON-RPC 2.0 request.
+type jsonRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"`
+}
+
+// jsonResponse is the wire shape of a JSON-RPC 2.0 response.
+type jsonResponse struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   interface{}     `json:"error,omitempty"`
+}
+
+// JsonCodec speaks the JSON-RPC 2.0 wire format, and also reads the
+// requests net/rpc/jsonrpc's JSON-RPC 1.0 client sends, so a geerpc server can interoperate with any JSON-RPC 2.0 peer instead
+// of only other geerpc processes. It is wired for that server direction
+// only: ReadHeader decodes an incoming request and Write always emits a
+// response keyed off the pending map ReadHeader filled in. Setting
+// Option{CodecType: JsonType} on a geerpc Client does not work the other
+// way around, the way net/rpc/jsonrpc's separate ClientCodec does; a
+// geerpc.Client still needs the gob codec (or a foreign JSON-RPC client)
+// on the other end of the wire.
+type JsonCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer // Write is buffered through this and flushed per message.
+	dec  *json.Decoder
+	enc  *json.Encoder
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]json.RawMessage // Header.Seq -> the request's original id, so Write can echo it back.
+
+	req jsonRequest // the request ReadHeader just decoded; ReadBody reads its Params.
+}
+
+var _ Codec = (*JsonCodec)(nil)
+
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	return &JsonCodec{
+		conn:    conn,
+		buf:     buf,
+		dec:     json.NewDecoder(conn),
+		enc:     json.NewEncoder(buf),
+		pending: make(map[uint64]json.RawMessage),
+	}
+}
+
+// ReadHeader decodes one JSON-RPC 2.0 request object. Its arbitrary-typed
+// id is stashed in pending under a sequence number we mint ourselves,
+// since Header.Seq must be a uint64; Write looks it up later to restore
+// the original id on the response.
+func (c *JsonCodec) ReadHeader(h *Header) error {
+	c.req = jsonRequest{}
+	if err := c.dec.Decode(&c.req); err != nil {
+		return err
+	}
+	h.ServiceMethod = c.req.Method
+	h.Error = ""
+
+	c.mu.Lock()
+	c.seq++
+	c.pending[c.seq] = c.req.Id
+	h.Seq = c.seq
+	c.mu.Unlock()
+	return nil
+}
+
+// ReadBody decodes the params field ReadHeader deferred into body.
+// params is usually a single JSON object, but net/rpc/jsonrpc (and
+// JSON-RPC 2.0 peers following its convention) sends positional
+// params as a one-element array instead, so an array is unwrapped
+// before decoding its first element into body.
+func (c *JsonCodec) ReadBody(body interface{}) error {
+	if body == nil || len(c.req.Params) == 0 {
+		return nil
+	}
+	params := c.req.Params
+	if trimmed := bytes.TrimLeft(params, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); err != nil {
+			return err
+		}
+		if len(positional) == 0 {
+			return nil
+		}
+		params = positional[0]
+	}
+	return json.Unmarshal(params, body)
+}
+
+// Write emits a JSON-RPC 2.0 response for h.Seq, restoring whichever id
+// the matching request carried, then flushes immediately since each
+// response must reach the peer as a complete message. A streaming call
+// (h.Flag&FlagStream) sends several frames under the same Seq, so the
+// pending entry is only dropped once the terminal frame (FlagEOS) goes
+// out; dropping it on the first frame would make every later Send for
+// that stream fail to find a pending request.
+func (c *JsonCodec) Write(h *Header, body interface{}) error {
+	c.mu.Lock()
+	id, ok := c.pending[h.Seq]
+	if ok && (h.Flag&FlagStream == 0 || h.Flag&FlagEOS != 0) {
+		delete(c.pending, h.Seq)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("codec: no pending request for seq %d", h.Seq)
+	}
+
+	defer func() {
+		if err := c.buf.Flush(); err != nil {
+			_ = c.Close()
+		}
+	}()
+
+	resp := jsonResponse{Version: "2.0", Id: id}
+	if h.Error != "" {
+		resp.Error = h.Error
+	} else {
+		resp.Result = body
+	}
+	return c.enc.Encode(&resp)
+}
+
+func (c *JsonCodec) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,126 @@
+package geerpc
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GeeRegistry is a simple in-memory HTTP service registry: servers
+// announce themselves (and keep renewing) via POST, and clients list the
+// currently alive set via GET.
+type GeeRegistry struct {
+	timeout time.Duration
+	mu      sync.Mutex
+	servers map[string]*registryItem
+}
+
+type registryItem struct {
+	Addr  string
+	start time.Time
+}
+
+const (
+	defaultRegistryPath = "/_geerpc_/registry"
+	defaultTimeout      = time.Minute * 5
+)
+
+// NewGeeRegistry creates a registry that forgets a server once timeout has
+// passed without a heartbeat; a zero timeout never expires entries.
+func NewGeeRegistry(timeout time.Duration) *GeeRegistry {
+	return &GeeRegistry{
+		servers: make(map[string]*registryItem),
+		timeout: timeout,
+	}
+}
+
+// DefaultGeeRegister is the default instance of *GeeRegistry.
+var DefaultGeeRegister = NewGeeRegistry(defaultTimeout)
+
+func (r *GeeRegistry) putServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.servers[addr]
+	if s == nil {
+		r.servers[addr] = &registryItem{Addr: addr, start: time.Now()}
+	} else {
+		s.start = time.Now() // heartbeat, renew it.
+	}
+}
+
+func (r *GeeRegistry) aliveServers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var alive []string
+	for addr, s := range r.servers {
+		if r.timeout == 0 || s.start.Add(r.timeout).After(time.Now()) {
+			alive = append(alive, addr)
+		} else {
+			delete(r.servers, addr)
+		}
+	}
+	sort.Strings(alive)
+	return alive
+}
+
+// ServeHTTP answers GET with the alive server set in the X-Geerpc-Servers
+// header, and POST as a heartbeat from the server named in X-Geerpc-Server.
+func (r *GeeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		w.Header().Set("X-Geerpc-Servers", strings.Join(r.aliveServers(), ","))
+	case "POST":
+		addr := req.Header.Get("X-Geerpc-Server")
+		if addr == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.putServer(addr)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleHTTP registers r at registryPath on http.DefaultServeMux.
+func (r *GeeRegistry) HandleHTTP(registryPath string) {
+	http.Handle(registryPath, r)
+}
+
+// HandleRegistryHTTP registers DefaultGeeRegister at the default registry
+// path.
+func HandleRegistryHTTP() {
+	DefaultGeeRegister.HandleHTTP(defaultRegistryPath)
+}
+
+// Heartbeat sends addr to registry as a POST, then keeps resending every
+// duration so a GeeRegistryDiscovery client keeps finding this server;
+// duration defaults to just under the registry's expiry window.
+func Heartbeat(registry, addr string, duration time.Duration) {
+	if duration == 0 {
+		duration = defaultTimeout - time.Minute
+	}
+	var err error
+	err = sendHeartbeat(registry, addr)
+	go func() {
+		t := time.NewTicker(duration)
+		for err == nil {
+			<-t.C
+			err = sendHeartbeat(registry, addr)
+		}
+	}()
+}
+
+func sendHeartbeat(registry, addr string) error {
+	log.Println(addr, "send heartbeat to registry", registry)
+	httpClient := &http.Client{}
+	req, _ := http.NewRequest("POST", registry, nil)
+	req.Header.Set("X-Geerpc-Server", addr)
+	if _, err := httpClient.Do(req); err != nil {
+		log.Println("rpc server: heartbeat err:", err)
+		return err
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"reflect"
 	"strings"
 	"sync"
@@ -165,7 +166,9 @@ func (s *Server) readRequest(cc codec.Codec) (*request, error) {
 		return nil, err
 	}
 	req.argv = req.mtype.newArgs()
-	req.replyv = req.mtype.newReplyv()
+	if !req.mtype.isStream {
+		req.replyv = req.mtype.newReplyv()
+	}
 
 	// make sure that argvi is a pointer,
 	// ReadBody need a pointer as parameter.
@@ -185,6 +188,19 @@ func (s *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex
 	called := make(chan struct{})
 	sent := make(chan struct{})
 	go func() {
+		if req.mtype.isStream {
+			stream := &Stream{cc: cc, sending: sending, seq: req.h.Seq}
+			err := req.svc.call(req.mtype, req.argv, reflect.ValueOf(stream))
+			called <- struct{}{}
+			eos := &codec.Header{ServiceMethod: req.h.ServiceMethod, Seq: req.h.Seq, Flag: codec.FlagStream | codec.FlagEOS}
+			if err != nil {
+				eos.Flag |= codec.FlagError
+				eos.Error = err.Error()
+			}
+			s.sendResponse(cc, eos, invalidRequest, sending)
+			sent <- struct{}{}
+			return
+		}
 		err := req.svc.call(req.mtype, req.argv, req.replyv)
 		called <- struct{}{}
 		if err != nil {
@@ -203,6 +219,21 @@ func (s *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex
 	}
 	select {
 	case <- time.After(timeout):
+		if req.mtype.isStream {
+			// A timed-out streaming call still owes the client an EOS
+			// frame: Client.receive only routes a frame into the
+			// streams map when FlagStream is set, so an untagged
+			// reply here would be silently dropped and StreamGo's
+			// reply channel would never close.
+			eos := &codec.Header{
+				ServiceMethod: req.h.ServiceMethod,
+				Seq:           req.h.Seq,
+				Flag:          codec.FlagStream | codec.FlagEOS | codec.FlagError,
+				Error:         fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout),
+			}
+			s.sendResponse(cc, eos, invalidRequest, sending)
+			break
+		}
 		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
 		s.sendResponse(cc, req.h, invalidRequest, sending)
 	case <- called:
@@ -251,3 +282,42 @@ func (s *Server) findService(serviceMethod string) (svc *service, mtype *methodT
 	return
 }
 
+const (
+	connected        = "200 Connected to Gee RPC"
+	defaultRPCPath   = "/_geerpc_"
+	defaultDebugPath = "/debug/geerpc"
+)
+
+// ServeHTTP implements an http.Handler that hijacks a CONNECT request
+// and hands the raw connection to ServeConn, so RPC traffic can share
+// port 80/443 with a web app instead of needing its own listener.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "CONNECT" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		log.Print("rpc hijacking ", req.RemoteAddr, ": ", err.Error())
+		return
+	}
+	io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
+	s.ServeConn(conn)
+}
+
+// HandleHTTP registers rpcPath as an RPC endpoint and debugPath as a
+// human-readable page of registered services and their call counts, both
+// on http.DefaultServeMux.
+func (s *Server) HandleHTTP(rpcPath, debugPath string) {
+	http.Handle(rpcPath, s)
+	http.Handle(debugPath, debugHTTP{s})
+}
+
+// HandleHTTP registers HTTP handlers for DefaultServer at the default
+// paths.
+func HandleHTTP() {
+	DefaultServer.HandleHTTP(defaultRPCPath, defaultDebugPath)
+}
+
@@ -0,0 +1,29 @@
+package geerpc
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/codec"
+)
+
+// Stream is handed to a method shaped func(args T, stream *Stream) error
+// instead of the usual reply value, letting it send any number of
+// replies for a single request before returning.
+type Stream struct {
+	cc      codec.Codec
+	sending *sync.Mutex // the same mutex serveCodec uses, so frames never interleave with ordinary responses.
+	seq     uint64
+}
+
+// Send writes one more reply frame for this call.
+func (s *Stream) Send(reply interface{}) error {
+	s.sending.Lock()
+	defer s.sending.Unlock()
+	h := &codec.Header{Seq: s.seq, Flag: codec.FlagStream}
+	return s.cc.Write(h, reply)
+}
+
+// streamType identifies a registered method as streaming: its third
+// parameter is *Stream rather than an exported reply type.
+var streamType = reflect.TypeOf((*Stream)(nil))
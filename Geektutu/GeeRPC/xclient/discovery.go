@@ -0,0 +1,165 @@
+package xclient
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SelectMode picks which server Discovery.Get hands back for a call.
+type SelectMode int
+
+const (
+	RandomSelect     SelectMode = iota // select randomly
+	RoundRobinSelect                   // select using round-robin
+	EWMASelect                         // select the server with the lowest observed EWMA latency
+)
+
+// Discovery is the minimal interface XClient needs to find servers for a
+// service, whatever backs it (a static list, an HTTP registry, ...).
+type Discovery interface {
+	Refresh() error // refresh from remote registry if needed
+	Update(servers []string) error
+	Get(mode SelectMode) (string, error)
+	GetAll() ([]string, error)
+	// Observe records a completed call's round-trip latency against
+	// server, feeding EWMASelect.
+	Observe(server string, rtt time.Duration)
+}
+
+var _ Discovery = (*MultiServersDiscovery)(nil)
+
+// MultiServersDiscovery is a Discovery backed by a static, manually
+// updated server list.
+type MultiServersDiscovery struct {
+	r       *rand.Rand
+	mu      sync.Mutex
+	servers []string
+	index   int
+	latency map[string]*ewma
+}
+
+// NewMultiServersDiscovery creates a MultiServersDiscovery over servers.
+func NewMultiServersDiscovery(servers []string) *MultiServersDiscovery {
+	d := &MultiServersDiscovery{
+		servers: servers,
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		latency: make(map[string]*ewma),
+	}
+	d.index = d.r.Intn(math.MaxInt32 - 1) // avoid every Discovery starting round-robin at 0
+	return d
+}
+
+// Refresh is a no-op: a static server list has nothing to fetch.
+func (d *MultiServersDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *MultiServersDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	return nil
+}
+
+func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.servers)
+	if n == 0 {
+		return "", errors.New("rpc discovery: no available servers")
+	}
+	switch mode {
+	case RandomSelect:
+		return d.servers[d.r.Intn(n)], nil
+	case RoundRobinSelect:
+		s := d.servers[d.index%n]
+		d.index = (d.index + 1) % n
+		return s, nil
+	case EWMASelect:
+		best := d.servers[0]
+		bestLatency := d.latencyLocked(best)
+		for _, s := range d.servers[1:] {
+			if l := d.latencyLocked(s); l < bestLatency {
+				best, bestLatency = s, l
+			}
+		}
+		return best, nil
+	default:
+		return "", errors.New("rpc discovery: not supported select mode")
+	}
+}
+
+// latencyLocked reports server's current EWMA latency, or 0 for a server
+// that hasn't been observed yet so new/untested endpoints get tried first.
+func (d *MultiServersDiscovery) latencyLocked(server string) float64 {
+	e, ok := d.latency[server]
+	if !ok {
+		return 0
+	}
+	return e.get()
+}
+
+func (d *MultiServersDiscovery) Observe(server string, rtt time.Duration) {
+	d.mu.Lock()
+	e, ok := d.latency[server]
+	if !ok {
+		e = &ewma{}
+		d.latency[server] = e
+	}
+	d.mu.Unlock()
+	e.observe(rtt)
+}
+
+func (d *MultiServersDiscovery) GetAll() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	servers := make([]string, len(d.servers))
+	copy(servers, d.servers)
+	return servers, nil
+}
+
+// ewmaAlpha weights the most recent observation; 0.2 is a common default
+// that smooths noise without reacting too slowly to real latency shifts.
+const ewmaAlpha = 0.2
+
+// ewmaFailurePenalty is the latency XClient.call feeds into Observe when
+// a call fails outright, rather than skipping the observation. A server
+// that is down would otherwise sit at latencyLocked's unobserved value
+// (0, the lowest possible) forever, since a failed call has no real
+// round-trip to record, and EWMASelect would keep re-picking it over any
+// server that has actually been measured — real latencies are never
+// less than the 0 a dead server is stuck at. Penalizing failures moves
+// a consistently-dead server's EWMA up past any real server's, so
+// selection converges onto one that works.
+const ewmaFailurePenalty = 2 * time.Second
+
+// ewma tracks one server's exponentially weighted moving average latency.
+type ewma struct {
+	mu    sync.Mutex
+	value float64
+	seen  bool
+}
+
+func (e *ewma) observe(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v := float64(d)
+	if !e.seen {
+		e.value = v
+		e.seen = true
+		return
+	}
+	e.value = ewmaAlpha*v + (1-ewmaAlpha)*e.value
+}
+
+func (e *ewma) get() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.seen {
+		return 0
+	}
+	return e.value
+}
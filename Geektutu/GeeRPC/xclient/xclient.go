@@ -0,0 +1,166 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geerpc"
+)
+
+// XClient wraps a Discovery and a pool of geerpc.Client connections,
+// picking one server per call via mode and reusing its connection across
+// later calls instead of dialing fresh every time.
+type XClient struct {
+	d       Discovery
+	mode    SelectMode
+	opt     *geerpc.Option
+	mu      sync.Mutex
+	clients map[string]*geerpc.Client
+}
+
+var _ io.Closer = (*XClient)(nil)
+
+func NewXClient(d Discovery, mode SelectMode, opt *geerpc.Option) *XClient {
+	return &XClient{
+		d:       d,
+		mode:    mode,
+		opt:     opt,
+		clients: make(map[string]*geerpc.Client),
+	}
+}
+
+// Close closes every pooled connection.
+func (xc *XClient) Close() error {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for key, client := range xc.clients {
+		_ = client.Close()
+		delete(xc.clients, key)
+	}
+	return nil
+}
+
+// xDial dials rpcAddr, a "protocol@addr" string such as "tcp@10.0.0.1:8000"
+// or "http@10.0.0.1:8000" for a server registered via HandleHTTP.
+func xDial(rpcAddr string, opt *geerpc.Option) (*geerpc.Client, error) {
+	parts := strings.SplitN(rpcAddr, "@", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rpc client: wrong rpcAddr format %q, expect protocol@addr", rpcAddr)
+	}
+	protocol, addr := parts[0], parts[1]
+	if protocol == "http" {
+		return geerpc.DialHTTP("tcp", addr, opt)
+	}
+	return geerpc.Dial(protocol, addr, opt)
+}
+
+// dial returns a cached connection to rpcAddr, replacing it with a fresh
+// one if it's missing or has gone bad.
+func (xc *XClient) dial(rpcAddr string) (*geerpc.Client, error) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	client, ok := xc.clients[rpcAddr]
+	if ok && !client.IsAvailable() {
+		_ = client.Close()
+		delete(xc.clients, rpcAddr)
+		client = nil
+	}
+	if client == nil {
+		var err error
+		client, err = xDial(rpcAddr, xc.opt)
+		if err != nil {
+			return nil, err
+		}
+		xc.clients[rpcAddr] = client
+	}
+	return client, nil
+}
+
+func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = client.Call(ctx, serviceMethod, args, reply)
+	if err == nil {
+		// A server that is down or refusing connections fails fast, so
+		// letting its near-zero elapsed time in as its "latency" would
+		// make EWMASelect prefer it over servers that are actually up
+		// and just a bit slower.
+		xc.d.Observe(rpcAddr, time.Since(start))
+	} else {
+		// Still record something on failure: otherwise a dead server
+		// never leaves latencyLocked's unobserved (0, most-preferred)
+		// value and EWMASelect re-picks it forever (see
+		// ewmaFailurePenalty).
+		xc.d.Observe(rpcAddr, ewmaFailurePenalty)
+	}
+	return err
+}
+
+// Call selects one server via xc.mode and invokes serviceMethod on it.
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	rpcAddr, err := xc.d.Get(xc.mode)
+	if err != nil {
+		return err
+	}
+	return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+}
+
+// Broadcast fans serviceMethod out to every known server concurrently,
+// cancelling the rest as soon as one succeeds (reply, if non-nil, is
+// filled from that server) and returning nil once every call has
+// finished, or the first error seen if all of them have failed.
+func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var callErr error
+	succeeded := false
+
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			var clonedReply interface{}
+			if reply != nil {
+				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			err := xc.call(rpcAddr, ctx, serviceMethod, args, clonedReply)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if callErr == nil {
+					callErr = err
+				}
+				return
+			}
+			if !succeeded {
+				if reply != nil {
+					reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(clonedReply).Elem())
+				}
+				succeeded = true
+				cancel() // got a winner, stop waiting on the rest.
+			}
+		}(rpcAddr)
+	}
+	wg.Wait()
+	if succeeded {
+		return nil
+	}
+	return callErr
+}
@@ -0,0 +1,65 @@
+package mr
+
+import "time"
+
+// defaultBackupThreshold is used when Master.BackupThreshold is zero.
+const defaultBackupThreshold = 0.1
+
+// maxAttemptsPerTask caps how many attempts pickBackupTask lets a task
+// accumulate: it counts every attempt ever dispatched (including a
+// re-dispatch after a lease expired), so a task gets at most one backup
+// and none once it already has two attempts. That is enough to tame
+// stragglers without flooding the cluster if a task is simply slow for
+// everyone.
+const maxAttemptsPerTask = 2
+
+// beginAttempt records a new attempt at task id by worker, whether it is
+// the task's first dispatch or a backup copy handed to another worker
+// while the original is still running.
+func (m *Master) beginAttempt(id int, worker WorkerID) {
+	t := m.TaskMeta[id]
+	t.TaskStatus = InProgress
+	t.StartTime = time.Now()
+	m.nextAttemptId++
+	t.Attempts = append(t.Attempts, Attempt{Id: m.nextAttemptId, WorkerID: worker, StartTime: t.StartTime, Status: InProgress})
+	m.wal.append(journalRecord{Op: opAssign, TaskId: id, StartTime: t.StartTime})
+}
+
+// remainingFraction returns the share of the current phase's tasks that
+// are not yet Completed.
+func (m *Master) remainingFraction() float64 {
+	if len(m.TaskMeta) == 0 {
+		return 0
+	}
+	remaining := 0
+	for _, t := range m.TaskMeta {
+		if t.TaskStatus != Completed {
+			remaining++
+		}
+	}
+	return float64(remaining) / float64(len(m.TaskMeta))
+}
+
+// pickBackupTask returns a still-InProgress task to hand to another idle
+// worker as a backup attempt, once the phase is mostly done, per the
+// "backup execution" idea in the original MapReduce paper. It never
+// cancels the original attempt; both run to completion, and
+// TaskCompleted accepts whichever reports in first.
+func (m *Master) pickBackupTask() *Task {
+	if m.DisableBackup || m.Phase == Exit || m.Phase == Wait {
+		return nil
+	}
+	threshold := m.BackupThreshold
+	if threshold == 0 {
+		threshold = defaultBackupThreshold
+	}
+	if m.remainingFraction() >= threshold {
+		return nil
+	}
+	for _, t := range m.TaskMeta {
+		if t.TaskStatus == InProgress && len(t.Attempts) < maxAttemptsPerTask {
+			return t.TaskPtr
+		}
+	}
+	return nil
+}
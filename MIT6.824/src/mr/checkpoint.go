@@ -0,0 +1,222 @@
+package mr
+
+import (
+	"encoding/gob"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultJournalPath is where MakeMaster looks for (and creates) the WAL
+// when the caller does not name one explicitly.
+const defaultJournalPath = "mr-master.wal"
+
+// journalOp identifies the kind of state transition recorded in the WAL.
+type journalOp int
+
+const (
+	opInit journalOp = iota
+	opAssign
+	opComplete
+	opPhaseChange
+	opRequeue
+)
+
+// journalRecord is a single WAL entry describing one state transition.
+// Replaying every record in order (the opInit record creates the
+// Master) reconstructs the phase, task statuses and intermediate paths
+// as they were before the crash. Worker leases and per-task Attempts are
+// not journaled, and InterMediateCache is only re-derived from partition
+// files the master can still read.
+type journalRecord struct {
+	Op            journalOp
+	TaskId        int
+	Phase         State
+	StartTime     time.Time
+	InputFiles    []string
+	NReduce       int
+	InterMediates [][]string // snapshot, only set on opPhaseChange into Reduce.
+	// TaskInterMediates/TaskOutput carry a completed task's own output
+	// paths (Task.InterMediates/Task.Output), only set on opComplete, so
+	// replaying that record can repopulate m.InterMediates for a Map task
+	// without needing the in-memory Task that produced it.
+	TaskInterMediates []string
+	TaskOutput        string
+}
+
+// journal wraps the append-only WAL file. Every record is fsync'd before
+// the call that produced it returns, so a crash never loses an
+// acknowledged state transition.
+type journal struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *gob.Encoder
+	path string
+}
+
+func openJournal(path string) (*journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{file: file, enc: gob.NewEncoder(file), path: path}, nil
+}
+
+func (j *journal) append(rec journalRecord) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.enc.Encode(&rec); err != nil {
+		log.Println("mr master: failed to append journal record:", err)
+		return
+	}
+	if err := j.file.Sync(); err != nil {
+		log.Println("mr master: failed to fsync journal:", err)
+	}
+}
+
+// finish removes the WAL once its job has reached Exit. A finished job
+// has nothing left to recover, and leaving a journal behind — even one
+// compacted down to a single record — would make the next MakeMaster
+// in this directory see a journal and take the recovery branch instead
+// of starting its own files/nReduce fresh, which is both wrong for a
+// new job and, while TaskQueue still held the old job's tasks, a
+// deadlock. Deleting it is what lets loadJournal tell a completed job
+// (no file) from a crashed one (a file with no terminating Exit).
+func (j *journal) finish() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.file.Close()
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		log.Println("mr master: failed to remove finished journal:", err)
+	}
+}
+
+// loadJournal replays path and rebuilds the Master it describes.
+// It returns ok == false when the journal does not exist yet, which
+// tells the caller to start a fresh job instead of recovering one.
+func loadJournal(path string) (m *Master, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	dec := gob.NewDecoder(file)
+	for {
+		var rec journalRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err != io.EOF {
+				// A torn record tail means the master crashed mid-write;
+				// everything before it is still valid, so stop replaying
+				// instead of failing the whole recovery.
+				log.Println("mr master: journal ended early, discarding tail:", err)
+			}
+			break
+		}
+		m = applyJournalRecord(m, rec)
+	}
+	if m == nil {
+		return nil, false
+	}
+	m.requeueExpired()
+	return m, true
+}
+
+// applyJournalRecord folds one WAL record into the in-memory state being
+// reconstructed, creating it on the opInit record that starts every log.
+// It only ever builds TaskMeta, never TaskQueue: requeueExpired is the
+// sole queue-filler once loadJournal finishes replaying, so a record
+// here doing both would double-fill TaskQueue past its capacity and
+// deadlock the send.
+func applyJournalRecord(m *Master, rec journalRecord) *Master {
+	switch rec.Op {
+	case opInit:
+		m = &Master{
+			TaskQueue:     make(chan *Task, max(rec.NReduce, len(rec.InputFiles))),
+			TaskMeta:      make(map[int]*MasterTask),
+			Phase:         rec.Phase,
+			NReduce:       rec.NReduce,
+			InputFiles:    rec.InputFiles,
+			InterMediates: make([][]string, rec.NReduce),
+			Workers:       make(map[WorkerID]*workerLease),
+			InterMediateCache: make(map[string][]KeyValue),
+		}
+		m.createMapTaskMeta()
+	case opAssign:
+		if t, ok := m.TaskMeta[rec.TaskId]; ok {
+			t.TaskStatus = InProgress
+			t.StartTime = rec.StartTime
+		}
+	case opComplete:
+		if t, ok := m.TaskMeta[rec.TaskId]; ok {
+			t.TaskStatus = Completed
+			if t.TaskPtr.TaskState == Map {
+				t.TaskPtr.InterMediates = rec.TaskInterMediates
+				for reduceId, filePath := range rec.TaskInterMediates {
+					m.InterMediates[reduceId] = append(m.InterMediates[reduceId], filePath)
+					// The journal only records this mapper's output
+					// paths, not the partition bytes, so re-derive
+					// InterMediateCache by reading the file back in
+					// where it's reachable from here (the common
+					// single-machine lab setup, or a mapper that
+					// happens to share a filesystem with the master).
+					// A reducer that isn't co-located with the mapper
+					// that produced this partition still can't be
+					// served after a crash+restart: the bytes were
+					// never journaled and the file lives on a machine
+					// the master has no way to reach.
+					if kvs, err := readLocalPartitionFile(filePath); err == nil {
+						m.InterMediateCache[filepath.Base(filePath)] = kvs
+					}
+				}
+			} else {
+				t.TaskPtr.Output = rec.TaskOutput
+			}
+		}
+	case opPhaseChange:
+		m.Phase = rec.Phase
+		if rec.Phase == Reduce {
+			m.InterMediates = rec.InterMediates
+			m.createReduceTaskMeta()
+		}
+	case opRequeue:
+		if t, ok := m.TaskMeta[rec.TaskId]; ok {
+			t.TaskStatus = Idle
+		}
+	}
+	return m
+}
+
+// requeueExpired is the only place that fills TaskQueue after a replay:
+// it re-fills TaskQueue with every task that replay left Idle or still
+// InProgress (the latter were assigned to a worker that never reported
+// back before the crash, so their deadline is treated as expired and
+// they get a fresh attempt). It runs once loadJournal has finished
+// folding in every record, so m.TaskMeta already reflects whichever
+// phase the job was in when it crashed (opPhaseChange into Reduce
+// replaces it wholesale via createReduceTaskMeta).
+func (m *Master) requeueExpired() {
+	ids := make([]int, 0, len(m.TaskMeta))
+	for id := range m.TaskMeta {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		t := m.TaskMeta[id]
+		if t.TaskStatus == Completed {
+			continue
+		}
+		t.TaskStatus = Idle
+		m.TaskQueue <- t.TaskPtr
+	}
+}
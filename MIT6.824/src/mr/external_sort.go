@@ -0,0 +1,153 @@
+package mr
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+)
+
+// defaultMaxReducerMemBytes is used when a worker doesn't set
+// WithMaxReducerMemBytes.
+const defaultMaxReducerMemBytes = 64 << 20 // 64MB
+
+// kvSize approximates a KeyValue's in-memory footprint, just enough to
+// decide when a run has grown past maxReducerMemBytes.
+func kvSize(kv KeyValue) int64 {
+	return int64(len(kv.Key) + len(kv.Value))
+}
+
+// spillRun sorts a run by key and writes it to a fresh temp file as a
+// sequence of gob records, returning the file's path. Each run is
+// small enough to sort in memory by construction: the caller spills
+// as soon as a run reaches maxReducerMemBytes.
+func spillRun(dir string, run []KeyValue) string {
+	sort.Sort(ByKey(run))
+	f, err := ioutil.TempFile(dir, "mr-run-*")
+	if err != nil {
+		log.Fatal("Failed to create run spill file: ", err)
+	}
+	enc := gob.NewEncoder(f)
+	for _, kv := range run {
+		if err := enc.Encode(&kv); err != nil {
+			log.Fatal("Failed to write run record: ", err)
+		}
+	}
+	f.Close()
+	return f.Name()
+}
+
+// kvIterator yields a sorted run's KeyValues one at a time, whether the
+// run lives on disk (fileIterator) or is still the small in-memory tail
+// that never needed to spill (sliceIterator).
+type kvIterator interface {
+	next() (KeyValue, bool)
+	close()
+}
+
+type fileIterator struct {
+	f   *os.File
+	dec *gob.Decoder
+}
+
+func newFileIterator(path string) *fileIterator {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal("Failed to open run spill file: ", err)
+	}
+	return &fileIterator{f: f, dec: gob.NewDecoder(f)}
+}
+
+func (it *fileIterator) next() (KeyValue, bool) {
+	var kv KeyValue
+	if err := it.dec.Decode(&kv); err != nil {
+		return KeyValue{}, false
+	}
+	return kv, true
+}
+
+func (it *fileIterator) close() { it.f.Close() }
+
+type sliceIterator struct {
+	kvs []KeyValue
+	idx int
+}
+
+func (it *sliceIterator) next() (KeyValue, bool) {
+	if it.idx >= len(it.kvs) {
+		return KeyValue{}, false
+	}
+	kv := it.kvs[it.idx]
+	it.idx++
+	return kv, true
+}
+
+func (it *sliceIterator) close() {}
+
+// heapItem is one candidate in the k-way merge: the next unread KeyValue
+// from source srcIdx.
+type heapItem struct {
+	kv     KeyValue
+	srcIdx int
+}
+
+type mergeHeap []heapItem
+
+func (h mergeHeap) Len() int            { return len(h) }
+func (h mergeHeap) Less(i, j int) bool  { return h[i].kv.Key < h[j].kv.Key }
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(heapItem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// externalMergeReduce k-way merges sources on a min-heap keyed by
+// KeyValue.Key, groups consecutive equal keys and streams each group
+// straight into reducef, writing "key value\n" lines to out exactly as
+// the in-memory reducer did. Because sources are already individually
+// sorted and the merge only ever holds one KeyValue per source, this
+// never needs the whole partition in memory, however large it is.
+func externalMergeReduce(sources []kvIterator, reducef func(string, []string) string, out io.Writer) {
+	h := &mergeHeap{}
+	heap.Init(h)
+	for i, src := range sources {
+		if kv, ok := src.next(); ok {
+			heap.Push(h, heapItem{kv: kv, srcIdx: i})
+		}
+	}
+
+	var curKey string
+	var values []string
+	haveCur := false
+	flush := func() {
+		if !haveCur {
+			return
+		}
+		output := reducef(curKey, values)
+		fmt.Fprintf(out, "%v %v\n", curKey, output)
+	}
+
+	for h.Len() > 0 {
+		top := heap.Pop(h).(heapItem)
+		if haveCur && top.kv.Key != curKey {
+			flush()
+			values = nil
+		}
+		curKey = top.kv.Key
+		haveCur = true
+		values = append(values, top.kv.Value)
+
+		if next, ok := sources[top.srcIdx].next(); ok {
+			heap.Push(h, heapItem{kv: next, srcIdx: top.srcIdx})
+		}
+	}
+	flush()
+}
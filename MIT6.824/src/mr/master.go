@@ -2,10 +2,7 @@ package mr
 
 import (
 	"log"
-	"net"
-	"net/http"
-	"net/rpc"
-	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -38,7 +35,47 @@ type Master struct {
 	// InterMediates cache all the intermediate result.
 	// [1] ['mr-1-1', 'mr-2-1', 'mr-3-1']
 	// [2] ['mr-1-2', 'mr-2-2', 'mr-3-2']
-	InterMediates 	[][]string	
+	InterMediates 	[][]string
+	// InterMediateCache holds the actual partition bytes of every
+	// completed Map task, keyed by "mr-<MapId>-<ReduceId>", so
+	// FetchIntermediate can serve a reducer on another machine without
+	// needing filesystem access to the mapper that produced it. The WAL
+	// only journals each Map task's output paths, not this cache's
+	// bytes (see applyJournalRecord), so after a crash+restart it is
+	// re-derived from whichever of those paths are still readable from
+	// the master; a reducer that isn't co-located with the mapper that
+	// produced its partition can't be served after a restart, since a
+	// Completed Map task is not run again.
+	InterMediateCache	map[string][]KeyValue
+	// wal journals every state transition so a crashed Master can be
+	// rebuilt by MakeMaster/MakeMasterFromCheckpoint instead of
+	// restarting the whole job from scratch.
+	wal 			*journal
+	snapshotDone	bool
+	// transport carries the master<->worker RPC traffic; it defaults to
+	// the original unix+gob socket but can be swapped via WithTCP,
+	// WithJSONRPC and WithTLS passed to MakeMaster.
+	transport		Transport
+	// BackupThreshold is the fraction (0,1] of a phase's tasks that may
+	// still be Idle or InProgress before the master starts dispatching
+	// backup copies of the remaining InProgress tasks. Zero means
+	// defaultBackupThreshold. DisableBackup turns the feature off
+	// entirely, e.g. for deterministic tests.
+	BackupThreshold	float64
+	DisableBackup	bool
+	// BackupWins counts tasks completed while more than one attempt had
+	// been dispatched at them; which attempt finished first is not
+	// tracked. BackupLosses counts completion reports that arrived after
+	// another attempt at the same task had already completed it.
+	BackupWins		int
+	BackupLosses	int
+	nextAttemptId	int
+	// Workers is the registry of workers that have called
+	// RegisterWorker, keyed by the WorkerID they were assigned.
+	// leaseSweeper uses it to re-queue only the tasks belonging to a
+	// worker whose lease has actually expired.
+	Workers 		map[WorkerID]*workerLease
+	nextWorkerID	WorkerID
 }
 
 type Task struct {
@@ -47,13 +84,34 @@ type Task struct {
 	Output			string
 	TaskState 		State
 	NReducer 		int
-	InterMediates 	[]string	
+	InterMediates 	[]string
+	// MapData carries this Map task's own partitions (indexed by
+	// reduceId, same order as InterMediates) back to the master on
+	// TaskCompleted, so FetchIntermediate can serve a reducer that isn't
+	// co-located with this mapper instead of reading InterMediates'
+	// paths off the master's own disk.
+	MapData			[][]KeyValue
+}
+
+// Attempt records one worker's try at a task. MasterTask keeps every
+// attempt it has dispatched so that when a backup copy races the
+// original, TaskCompleted can tell a legitimate late finisher from a
+// straggler reporting in after it already lost.
+type Attempt struct {
+	Id			int
+	WorkerID	WorkerID
+	StartTime	time.Time
+	Status		MasterTaskState
 }
 
 type MasterTask struct {
 	TaskStatus	MasterTaskState
 	StartTime	time.Time
 	TaskPtr		*Task
+	// Attempts is every attempt ever dispatched at this task, original
+	// plus any backups; leaseSweeper re-queues the task only once none
+	// of them belong to a still-live worker (see taskHasLiveAttempt).
+	Attempts	[]Attempt
 }
 
 // Your code here -- RPC handlers for the worker to call.
@@ -73,16 +131,14 @@ func (m *Master) Example(args *ExampleArgs, reply *ExampleReply) error {
 // start a thread that listens for RPCs from worker.go
 //
 func (m *Master) server() {
-	rpc.Register(m)
-	rpc.HandleHTTP()
-	//l, e := net.Listen("tcp", ":1234")
-	sockname := masterSock()
-	os.Remove(sockname)
-	l, e := net.Listen("unix", sockname)
+	if m.transport == nil {
+		m.transport = &unixGobTransport{sockname: masterSock()}
+	}
+	l, e := m.transport.Listen()
 	if e != nil {
 		log.Fatal("listen error:", e)
 	}
-	go http.Serve(l, nil)
+	m.transport.Serve(l, m)
 }
 
 //
@@ -101,7 +157,31 @@ func (m *Master) Done() bool {
 // main/mrmaster.go calls this function.
 // nReduce is the number of reduce tasks to use.
 //
-func MakeMaster(files []string, nReduce int) *Master {
+// If a WAL already exists at defaultJournalPath (left behind by a
+// coordinator that crashed mid-job), MakeMaster recovers the job from it
+// instead of starting over; files and nReduce are ignored in that case
+// since the journal already knows them. opts selects the RPC transport
+// (see WithTCP, WithJSONRPC, WithTLS); with none given it keeps the
+// original unix+gob socket.
+func MakeMaster(files []string, nReduce int, opts ...Option) *Master {
+	cfg := newMasterConfig(opts)
+
+	if recovered, ok := loadJournal(defaultJournalPath); ok {
+		log.Printf("mr master: recovered job from %s", defaultJournalPath)
+		wal, err := openJournal(defaultJournalPath)
+		if err != nil {
+			log.Fatal("mr master: failed to reopen journal:", err)
+		}
+		recovered.wal = wal
+		recovered.transport = cfg.transport
+		recovered.start()
+		return recovered
+	}
+
+	wal, err := openJournal(defaultJournalPath)
+	if err != nil {
+		log.Fatal("mr master: failed to open journal:", err)
+	}
 	m := Master{
 		TaskQueue: 		make(chan *Task, max(nReduce, len(files))),
 		TaskMeta: 		make(map[int]*MasterTask),
@@ -109,36 +189,90 @@ func MakeMaster(files []string, nReduce int) *Master {
 		NReduce: 		nReduce,
 		InputFiles: 	files,
 		InterMediates: 	make([][]string, nReduce),
+		wal: 			wal,
+		transport: 		cfg.transport,
+		Workers: 		make(map[WorkerID]*workerLease),
+		InterMediateCache: make(map[string][]KeyValue),
 	}
 
+	wal.append(journalRecord{Op: opInit, Phase: Map, InputFiles: files, NReduce: nReduce})
 	// Create a Map task for each input files when the master start.
-	m.createMapTask()
-	
-	// Run master server.
-	m.server()
-	go m.catchTimeOut()
+	m.createMapTaskNoJournal()
+
+	m.start()
 	return &m
 }
 
-func (m *Master) catchTimeOut() {
+// MakeMasterFromCheckpoint rebuilds a Master from the WAL at path,
+// for callers that keep their journal somewhere other than
+// defaultJournalPath. It fails loudly if no journal is found there,
+// since unlike MakeMaster there is no fresh-start fallback.
+func MakeMasterFromCheckpoint(path string, opts ...Option) *Master {
+	cfg := newMasterConfig(opts)
+	recovered, ok := loadJournal(path)
+	if !ok {
+		log.Fatalf("mr master: no journal found at %s", path)
+	}
+	wal, err := openJournal(path)
+	if err != nil {
+		log.Fatal("mr master: failed to reopen journal:", err)
+	}
+	recovered.wal = wal
+	recovered.transport = cfg.transport
+	log.Printf("mr master: recovered job from %s", path)
+	recovered.start()
+	return recovered
+}
+
+// start runs the RPC server and the background goroutines every Master
+// needs, regardless of whether it was created fresh or recovered.
+func (m *Master) start() {
+	if m.Workers == nil {
+		m.Workers = make(map[WorkerID]*workerLease)
+	}
+	m.server()
+	go m.leaseSweeper()
+	go m.snapshotCompactor()
+}
+
+// snapshotCompactor periodically checks whether the Reduce phase has
+// finished and, the first time it has, removes the WAL: the job is done,
+// so there is nothing left to recover, and a leftover journal would make
+// the next MakeMaster in this directory recover this finished job
+// instead of starting the next one (see journal.finish).
+func (m *Master) snapshotCompactor() {
 	for {
 		time.Sleep(5 * time.Second)
 		mu.Lock()
-		if m.Phase == Exit {
+		if m.Phase == Exit && !m.snapshotDone {
+			m.wal.finish()
+			m.snapshotDone = true
 			mu.Unlock()
 			return
 		}
-		for _, t := range m.TaskMeta {
-			if t.TaskStatus == InProgress && time.Now().Sub(t.StartTime) > 10 * time.Second {
-				m.TaskQueue <- t.TaskPtr
-				t.TaskStatus = Idle
-			}
-		}
+		done := m.Phase == Exit
 		mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+func (m *Master) createMapTaskNoJournal() {
+	m.createMapTaskMeta()
+	for idx := range m.InputFiles {
+		m.TaskQueue <- m.TaskMeta[idx].TaskPtr
 	}
 }
 
-func (m *Master) createMapTask() {
+// createMapTaskMeta (re)builds TaskMeta for every input file without
+// touching TaskQueue. It is the replay counterpart of
+// createMapTaskNoJournal: applyJournalRecord uses it to reconstruct
+// task state from an opInit record, leaving requeueExpired as the only
+// place that feeds TaskQueue once the whole log has been replayed.
+// Calling both would double-fill the queue and deadlock on a channel
+// send past its capacity.
+func (m *Master) createMapTaskMeta() {
 	for idx, filename := range m.InputFiles {
 		task := Task{
 			Id: idx,
@@ -146,7 +280,6 @@ func (m *Master) createMapTask() {
 			TaskState: Map,
 			NReducer: m.NReduce,
 		}
-		m.TaskQueue <- &task
 		m.TaskMeta[idx] = &MasterTask{
 			TaskStatus: Idle,
 			TaskPtr: 	&task,
@@ -154,7 +287,17 @@ func (m *Master) createMapTask() {
 	}
 }
 
-func (m *Master) createReduceTask() {
+func (m *Master) createReduceTaskNoJournal() {
+	m.createReduceTaskMeta()
+	for idx := range m.InterMediates {
+		m.TaskQueue <- m.TaskMeta[idx].TaskPtr
+	}
+}
+
+// createReduceTaskMeta is the replay counterpart of
+// createReduceTaskNoJournal; see createMapTaskMeta for why replay never
+// pushes to TaskQueue directly.
+func (m *Master) createReduceTaskMeta() {
 	m.TaskMeta = make(map[int]*MasterTask) // refresh the TaskMeta map prepare for Reduce task.
 	for idx, files := range m.InterMediates {
 		task := Task{
@@ -163,7 +306,6 @@ func (m *Master) createReduceTask() {
 			NReducer: m.NReduce,
 			InterMediates: files,
 		}
-		m.TaskQueue <- &task
 		m.TaskMeta[idx] = &MasterTask{
 			TaskStatus: Idle,
 			TaskPtr: &task,
@@ -172,13 +314,18 @@ func (m *Master) createReduceTask() {
 }
 
 // AssignTask: Assign task to the worker if has task in the TaskQueue.
+// Once the phase is nearly done, it also hands out backup copies of
+// still-InProgress tasks (see pickBackupTask) instead of telling the
+// worker to Wait.
 func (m *Master) AssignTask(args *TaskReq, reply *Task) error {
 	mu.Lock()
 	defer mu.Unlock()
 	if len(m.TaskQueue) > 0 {
 		*reply = *<-m.TaskQueue
-		m.TaskMeta[reply.Id].TaskStatus = InProgress
-		m.TaskMeta[reply.Id].StartTime = time.Now()
+		m.beginAttempt(reply.Id, args.WorkerID)
+	} else if backup := m.pickBackupTask(); backup != nil {
+		*reply = *backup
+		m.beginAttempt(reply.Id, args.WorkerID)
 	} else if m.Phase == Exit {
 		*reply = Task{TaskState: Exit}
 	} else {
@@ -187,13 +334,32 @@ func (m *Master) AssignTask(args *TaskReq, reply *Task) error {
 	return nil
 }
 
+// TaskCompleted accepts whichever attempt at a task reports in first;
+// a later attempt for the same task (the original racing a backup, or
+// vice versa) changes no task state here beyond counting a BackupLoss.
+// Its output is renamed onto the same file name as the winner's; since
+// writeToLocalFile/reducer write through a temp file and atomic rename,
+// that file always holds one attempt's complete output.
 func (m *Master) TaskCompleted(task *Task, reply *ExampleReply) error {
 	mu.Lock()
 	defer mu.Unlock()
-	if task.TaskState != m.Phase || m.TaskMeta[task.Id].TaskStatus == Completed {
+	t := m.TaskMeta[task.Id]
+	if task.TaskState != m.Phase || t.TaskStatus == Completed {
+		if t != nil && task.TaskState == m.Phase && t.TaskStatus == Completed {
+			m.BackupLosses++
+		}
 		return nil
 	}
-	m.TaskMeta[task.Id].TaskStatus = Completed
+	t.TaskStatus = Completed
+	if len(t.Attempts) > 1 {
+		m.BackupWins++
+	}
+	m.wal.append(journalRecord{
+		Op:                opComplete,
+		TaskId:            task.Id,
+		TaskInterMediates: task.InterMediates,
+		TaskOutput:        task.Output,
+	})
 	go m.processTaskResult(task)
 	return nil
 }
@@ -203,18 +369,25 @@ func (m *Master) processTaskResult(task *Task) {
 	defer mu.Unlock()
 	switch task.TaskState {
 	case Map:
-		// Collect the intermediates info.
+		// Collect the intermediates info and cache the partitions
+		// themselves so FetchIntermediate has real data to serve a
+		// reducer that doesn't share a filesystem with this mapper.
 		for reduceId, filePath := range task.InterMediates {
 			m.InterMediates[reduceId] = append(m.InterMediates[reduceId], filePath)
+			if reduceId < len(task.MapData) {
+				m.InterMediateCache[filepath.Base(filePath)] = task.MapData[reduceId]
+			}
 		}
 		if m.allTaskDone() {
 			// Start Reduce phase after all Map finish.
-			m.createReduceTask()
+			m.createReduceTaskNoJournal()
 			m.Phase = Reduce
+			m.wal.append(journalRecord{Op: opPhaseChange, Phase: Reduce, InterMediates: m.InterMediates})
 		}
 	case Reduce:
 		if m.allTaskDone() {
 			m.Phase = Exit
+			m.wal.append(journalRecord{Op: opPhaseChange, Phase: Exit})
 		}
 	}
 }
@@ -0,0 +1,118 @@
+package mr
+
+import "time"
+
+// WorkerID identifies a worker that has called RegisterWorker. It is
+// attached to every task AssignTask hands out so the master knows whom
+// to blame when a lease expires.
+type WorkerID int
+
+// leaseDuration is how long a registered worker may go without sending a
+// Heartbeat before the master gives up on it and re-queues its work.
+const leaseDuration = 10 * time.Second
+
+// heartbeatInterval is how often a well-behaved worker is expected to
+// call Heartbeat; it must stay comfortably below leaseDuration.
+const heartbeatInterval = 3 * time.Second
+
+type RegisterArgs struct{}
+
+type RegisterReply struct {
+	WorkerID WorkerID
+}
+
+// HeartbeatArgs reports a worker's current progress: which tasks it
+// still holds. Heartbeat only renews the sender's lease; it does not
+// read TaskIds.
+type HeartbeatArgs struct {
+	WorkerID WorkerID
+	TaskIds  []int
+}
+
+// HeartbeatReply.Exit tells the worker to shut down once the job has
+// reached the Exit phase, instead of it having to infer that from a
+// failed RPC.
+type HeartbeatReply struct {
+	Exit bool
+}
+
+// workerLease tracks when a registered worker was last heard from.
+// Dead is set once its lease has already been swept, so a late
+// heartbeat from a worker the master gave up on doesn't get treated as
+// proof of life again.
+type workerLease struct {
+	LastSeen time.Time
+	Dead     bool
+}
+
+// RegisterWorker assigns a fresh WorkerID and starts its lease. Workers
+// call this once, before their first AssignTask.
+func (m *Master) RegisterWorker(args *RegisterArgs, reply *RegisterReply) error {
+	mu.Lock()
+	defer mu.Unlock()
+	m.nextWorkerID++
+	id := m.nextWorkerID
+	m.Workers[id] = &workerLease{LastSeen: time.Now()}
+	reply.WorkerID = id
+	return nil
+}
+
+// Heartbeat renews a worker's lease and tells it whether the job is
+// done. Workers call this every heartbeatInterval from a background
+// goroutine while they work through their assigned tasks.
+func (m *Master) Heartbeat(args *HeartbeatArgs, reply *HeartbeatReply) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if w, ok := m.Workers[args.WorkerID]; ok && !w.Dead {
+		w.LastSeen = time.Now()
+	}
+	reply.Exit = m.Phase == Exit
+	return nil
+}
+
+// leaseSweeper replaces the old fixed-interval catchTimeOut: rather than
+// re-queuing every InProgress task past a blanket deadline, it only acts
+// on workers whose lease has actually expired. A task is only re-queued
+// once every worker holding a live attempt at it has died — a task with
+// a backup attempt (backup.go) must keep running on whichever of the
+// original/backup worker is still alive, and marking just the most
+// recently dispatched attempt's worker as the owner would re-queue the
+// task out from under a still-live original the moment its backup's
+// worker happened to die. A worker that is simply slow but still
+// heartbeating keeps its task.
+func (m *Master) leaseSweeper() {
+	for {
+		time.Sleep(heartbeatInterval)
+		mu.Lock()
+		if m.Phase == Exit {
+			mu.Unlock()
+			return
+		}
+		for _, w := range m.Workers {
+			if !w.Dead && time.Since(w.LastSeen) > leaseDuration {
+				w.Dead = true
+			}
+		}
+		for _, t := range m.TaskMeta {
+			if t.TaskStatus != InProgress || m.taskHasLiveAttempt(t) {
+				continue
+			}
+			m.TaskQueue <- t.TaskPtr
+			t.TaskStatus = Idle
+			m.wal.append(journalRecord{Op: opRequeue, TaskId: t.TaskPtr.Id})
+		}
+		mu.Unlock()
+	}
+}
+
+// taskHasLiveAttempt reports whether any attempt recorded against t
+// (the original dispatch or a later backup) belongs to a worker that
+// hasn't been swept as dead yet.
+func (m *Master) taskHasLiveAttempt(t *MasterTask) bool {
+	for _, a := range t.Attempts {
+		if w, ok := m.Workers[a.WorkerID]; ok && !w.Dead {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package mr
+
+//
+// RPC definitions shared between master.go and worker.go.
+//
+// remember to capitalize all names.
+//
+
+import (
+	"os"
+	"strconv"
+)
+
+//
+// example to show how to declare the arguments
+// and reply for an RPC.
+//
+type ExampleArgs struct {
+	X int
+}
+
+type ExampleReply struct {
+	Y int
+}
+
+// TaskReq is what a worker sends when asking the master for work.
+// WorkerID identifies the caller so AssignTask can record which worker
+// a task was handed to (see Master.RegisterWorker).
+type TaskReq struct {
+	WorkerID WorkerID
+}
+
+// Cook up a unique-ish UNIX-domain socket name
+// in /var/tmp, for the master.
+// Can't use the current directory since
+// Athena AFS doesn't support UNIX-domain sockets.
+func masterSock() string {
+	s := "/var/tmp/824-mr-"
+	s += strconv.Itoa(os.Getuid())
+	return s
+}
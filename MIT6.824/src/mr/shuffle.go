@@ -0,0 +1,88 @@
+package mr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// fetchChunkKVs bounds how many KeyValues FetchIntermediate returns in a
+// single RPC, so a remote reducer pulls a large partition as a sequence
+// of bounded chunks (see remoteIntermediateIterator) instead of one
+// reply sized to the whole partition.
+const fetchChunkKVs = 4096
+
+// FetchArgs names one mapper's partition of the intermediate data and,
+// via Offset, which chunk of it the caller already has.
+type FetchArgs struct {
+	MapId    int
+	ReduceId int
+	Offset   int
+}
+
+// FetchReply carries one bounded chunk of the requested partition
+// (fetchChunkKVs KeyValues at a time) rather than a true wire stream,
+// since net/rpc's call/reply model has no lower-level framing to stream
+// through; Done tells the caller there's no further chunk to ask for.
+// Bounding each reply still saves a reducer from needing shared-
+// filesystem access to the mapper's output, without requiring the whole
+// partition in flight over one RPC.
+type FetchReply struct {
+	KVs  []KeyValue
+	Done bool
+}
+
+// FetchIntermediate lets a reducer pull mapper M's partition R over RPC,
+// one fetchChunkKVs-sized chunk at a time starting at args.Offset,
+// instead of opening it on a shared filesystem. It serves the partition
+// out of m.InterMediateCache, which every mapper populates via
+// TaskCompleted (Task.MapData) when it finishes, so this works even when
+// the master and the mapper don't share a filesystem; reading the path
+// straight off the master's own disk would only work when they happen
+// to be co-located. InterMediateCache itself still holds every
+// completed mapper's entire output in RAM (master.go's InterMediates
+// field comment), which remains a scalability limit for very large jobs
+// run off a single box — only the wire transfer to each reducer is
+// bounded here.
+func (m *Master) FetchIntermediate(args *FetchArgs, reply *FetchReply) error {
+	mu.Lock()
+	kvs, ok := m.InterMediateCache[fmt.Sprintf("mr-%d-%d", args.MapId, args.ReduceId)]
+	mu.Unlock()
+	if !ok {
+		return fmt.Errorf("mr master: no intermediate partition cached for map %d reduce %d", args.MapId, args.ReduceId)
+	}
+	if args.Offset > len(kvs) {
+		return fmt.Errorf("mr master: offset %d past end of map %d reduce %d partition (len %d)", args.Offset, args.MapId, args.ReduceId, len(kvs))
+	}
+	end := args.Offset + fetchChunkKVs
+	if end > len(kvs) {
+		end = len(kvs)
+	}
+	reply.KVs = kvs[args.Offset:end]
+	reply.Done = end >= len(kvs)
+	return nil
+}
+
+// readLocalPartitionFile reads one mapper partition file off disk in the
+// same mr-<MapId>-<ReduceId> JSON-lines format writeToLocalFile writes,
+// without worker.go's readLocalIntermediate fataling on a missing file:
+// the master uses it, best-effort, to re-derive InterMediateCache during
+// WAL replay (see applyJournalRecord), where a missing file just means
+// the mapper that produced it ran on a different machine.
+func readLocalPartitionFile(path string) ([]KeyValue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var kvs []KeyValue
+	dec := json.NewDecoder(file)
+	for {
+		var kv KeyValue
+		if err := dec.Decode(&kv); err != nil {
+			break
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs, nil
+}
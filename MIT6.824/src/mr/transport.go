@@ -0,0 +1,260 @@
+package mr
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+)
+
+// defaultTCPAddr is used when a TCP transport is selected without an
+// explicit address.
+const defaultTCPAddr = ":1234"
+
+// Transport decides how a worker reaches the master: which network
+// (unix socket vs tcp) carries the bytes and which codec (gob vs
+// JSON-RPC) frames the calls. MakeMaster and Worker negotiate this via
+// WithTCP/WithJSONRPC/WithTLS and their worker-side counterparts.
+type Transport interface {
+	// Listen opens the listener the master accepts connections on.
+	Listen() (net.Listener, error)
+	// Serve registers svc's RPC methods and serves requests received on l
+	// until it is closed.
+	Serve(l net.Listener, svc interface{})
+	// Dial connects a worker to the master and returns a ready client.
+	Dial() (*rpc.Client, error)
+}
+
+// unixGobTransport is today's default: a unix domain socket carrying
+// gob-encoded net/rpc traffic over an HTTP CONNECT tunnel.
+type unixGobTransport struct {
+	sockname string
+}
+
+func (t *unixGobTransport) Listen() (net.Listener, error) {
+	os.Remove(t.sockname)
+	return net.Listen("unix", t.sockname)
+}
+
+func (t *unixGobTransport) Serve(l net.Listener, svc interface{}) {
+	rpc.Register(svc)
+	rpc.HandleHTTP()
+	go http.Serve(l, nil)
+}
+
+func (t *unixGobTransport) Dial() (*rpc.Client, error) {
+	return rpc.DialHTTP("unix", t.sockname)
+}
+
+// tcpGobTransport is the cross-machine counterpart of unixGobTransport:
+// same gob codec, but reachable over the network via WithTCP(addr).
+type tcpGobTransport struct {
+	addr string
+	tls  *tls.Config
+}
+
+func (t *tcpGobTransport) Listen() (net.Listener, error) {
+	if t.tls != nil {
+		return tls.Listen("tcp", t.addr, t.tls)
+	}
+	return net.Listen("tcp", t.addr)
+}
+
+func (t *tcpGobTransport) Serve(l net.Listener, svc interface{}) {
+	rpc.Register(svc)
+	go rpc.Accept(l)
+}
+
+func (t *tcpGobTransport) Dial() (*rpc.Client, error) {
+	if t.tls != nil {
+		conn, err := tls.Dial("tcp", t.addr, t.tls)
+		if err != nil {
+			return nil, err
+		}
+		return rpc.NewClient(conn), nil
+	}
+	return rpc.Dial("tcp", t.addr)
+}
+
+// tcpJSONRPCTransport speaks JSON-RPC over TCP via net/rpc/jsonrpc, so
+// that workers written in other languages can join the job with
+// WithJSONRPC().
+type tcpJSONRPCTransport struct {
+	addr string
+	tls  *tls.Config
+}
+
+func (t *tcpJSONRPCTransport) Listen() (net.Listener, error) {
+	if t.tls != nil {
+		return tls.Listen("tcp", t.addr, t.tls)
+	}
+	return net.Listen("tcp", t.addr)
+}
+
+func (t *tcpJSONRPCTransport) Serve(l net.Listener, svc interface{}) {
+	rpc.Register(svc)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Println("mr master: jsonrpc accept error:", err)
+				return
+			}
+			go rpc.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+}
+
+func (t *tcpJSONRPCTransport) Dial() (*rpc.Client, error) {
+	var conn net.Conn
+	var err error
+	if t.tls != nil {
+		conn, err = tls.Dial("tcp", t.addr, t.tls)
+	} else {
+		conn, err = net.Dial("tcp", t.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return jsonrpc.NewClient(conn), nil
+}
+
+// masterConfig accumulates the Options passed to MakeMaster.
+type masterConfig struct {
+	transport Transport
+	tls       *tls.Config
+}
+
+// Option configures the transport a Master listens on. The zero value
+// (no options) preserves the original unix+gob behavior.
+type Option func(*masterConfig)
+
+// WithTCP makes the master listen for plain gob-over-TCP connections at
+// addr instead of its default unix socket, so workers on other hosts
+// can join.
+func WithTCP(addr string) Option {
+	return func(c *masterConfig) { c.transport = &tcpGobTransport{addr: addr} }
+}
+
+// WithJSONRPC switches the already-selected TCP transport (or
+// defaultTCPAddr if none was selected yet) to net/rpc/jsonrpc's
+// JSON-RPC 1.0 codec, which cross-language workers can speak without a
+// Go RPC stack.
+func WithJSONRPC() Option {
+	return func(c *masterConfig) {
+		addr := defaultTCPAddr
+		var cfg *tls.Config
+		switch t := c.transport.(type) {
+		case *tcpGobTransport:
+			addr, cfg = t.addr, t.tls
+		case *tcpJSONRPCTransport:
+			addr, cfg = t.addr, t.tls
+		}
+		c.transport = &tcpJSONRPCTransport{addr: addr, tls: cfg}
+	}
+}
+
+// WithTLS wraps whichever TCP transport is selected in TLS using cfg.
+// It has no effect on the default unix socket transport.
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *masterConfig) {
+		c.tls = cfg
+		switch t := c.transport.(type) {
+		case *tcpGobTransport:
+			t.tls = cfg
+		case *tcpJSONRPCTransport:
+			t.tls = cfg
+		}
+	}
+}
+
+func newMasterConfig(opts []Option) *masterConfig {
+	c := &masterConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.transport == nil {
+		c.transport = &unixGobTransport{sockname: masterSock()}
+	}
+	return c
+}
+
+// DialOption configures how Worker reaches the master; it mirrors
+// Option on the server side so the two are always set up to agree.
+type DialOption func(*DialOptions)
+
+// DialOptions is the resolved configuration built from the DialOptions
+// passed to Worker.
+type DialOptions struct {
+	transport          Transport
+	combinef           func(string, []string) string
+	partitionf         func(string, int) int
+	maxReducerMemBytes int64
+}
+
+// WithTCPDial points the worker at a master listening via WithTCP(addr).
+func WithTCPDial(addr string) DialOption {
+	return func(d *DialOptions) { d.transport = &tcpGobTransport{addr: addr} }
+}
+
+// WithJSONRPCDial points the worker at a master listening via
+// WithTCP(addr) + WithJSONRPC().
+func WithJSONRPCDial(addr string) DialOption {
+	return func(d *DialOptions) { d.transport = &tcpJSONRPCTransport{addr: addr} }
+}
+
+// WithTLSDial wraps whichever TCP transport is selected in TLS using cfg.
+func WithTLSDial(cfg *tls.Config) DialOption {
+	return func(d *DialOptions) {
+		switch t := d.transport.(type) {
+		case *tcpGobTransport:
+			t.tls = cfg
+		case *tcpJSONRPCTransport:
+			t.tls = cfg
+		}
+	}
+}
+
+// WithCombiner runs combinef over each partition's values for a key,
+// inside the mapper, before the intermediates are written to disk. This
+// is the same optimization as Hadoop's combiner: it shrinks the
+// intermediate files and the shuffle traffic the reducers have to pull,
+// which matters most for aggregations like word count.
+func WithCombiner(combinef func(key string, values []string) string) DialOption {
+	return func(d *DialOptions) { d.combinef = combinef }
+}
+
+// WithPartitioner replaces the default ihash(key)%nReduce partitioner,
+// e.g. with a range partitioner that produces globally sorted output
+// across the reduce tasks.
+func WithPartitioner(partitionf func(key string, nReduce int) int) DialOption {
+	return func(d *DialOptions) { d.partitionf = partitionf }
+}
+
+// WithMaxReducerMemBytes bounds how much intermediate data the reducer
+// sorts in memory before spilling a run to disk (see external_sort.go).
+// Lower it to keep a worker's memory footprint small on a partition
+// that doesn't fit in RAM; the default is defaultMaxReducerMemBytes.
+func WithMaxReducerMemBytes(n int64) DialOption {
+	return func(d *DialOptions) { d.maxReducerMemBytes = n }
+}
+
+func newDialOptions(opts []DialOption) *DialOptions {
+	d := &DialOptions{}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.transport == nil {
+		d.transport = &unixGobTransport{sockname: masterSock()}
+	}
+	if d.partitionf == nil {
+		d.partitionf = func(key string, nReduce int) int { return ihash(key) % nReduce }
+	}
+	if d.maxReducerMemBytes == 0 {
+		d.maxReducerMemBytes = defaultMaxReducerMemBytes
+	}
+	return d
+}
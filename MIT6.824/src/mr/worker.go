@@ -6,10 +6,10 @@ import (
 	"hash/fnv"
 	"io/ioutil"
 	"log"
-	"net/rpc"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 )
 
@@ -38,10 +38,44 @@ func (a ByKey) Len() int			{ return len(a) }
 func (a ByKey) Swap(i, j int )		{ a[i], a[j] = a[j], a[i] }
 func (a ByKey) Less(i, j int) bool 	{ return a[i].Key < a[j].Key }
 
+// workerTransport carries this worker's RPC calls to the master; it is
+// set once by Worker from the DialOptions passed in, and defaults to the
+// same unix+gob socket Worker always dialed before transports existed.
+var workerTransport Transport = &unixGobTransport{sockname: masterSock()}
+
+// workerCombine, when non-nil, folds each partition's values for a key
+// together in mapper before they ever hit disk. workerPartition decides
+// which reduce partition a key goes to and defaults to ihash(key)%nReduce.
+var workerCombine func(string, []string) string
+var workerPartition func(string, int) int = func(key string, nReduce int) int { return ihash(key) % nReduce }
+
+// workerID is this process's identity with the master, handed out by
+// RegisterWorker. workerCurrentTasks is whatever task(s) it is holding
+// right now, reported on every Heartbeat; the master's lease sweep goes
+// by when the heartbeat arrived, not by this list.
+var workerID WorkerID
+var workerTaskMu sync.Mutex
+var workerCurrentTasks []int
+
+// maxReducerMemBytes bounds how much intermediate data reducer sorts in
+// memory before spilling a run to disk; see WithMaxReducerMemBytes.
+var maxReducerMemBytes int64 = defaultMaxReducerMemBytes
+
 //
-// main/mrworker.go calls this function.
+// main/mrworker.go calls this function. opts lets the worker join a
+// master that was started with WithTCP/WithJSONRPC/WithTLS, via the
+// matching WithTCPDial/WithJSONRPCDial/WithTLSDial, and can install a
+// WithCombiner/WithPartitioner for the mapper.
 //
-func Worker(mapf func(string, string) []KeyValue, reducef func(string, []string) string) {
+func Worker(mapf func(string, string) []KeyValue, reducef func(string, []string) string, opts ...DialOption) {
+	resolved := newDialOptions(opts)
+	workerTransport = resolved.transport
+	workerCombine = resolved.combinef
+	workerPartition = resolved.partitionf
+	maxReducerMemBytes = resolved.maxReducerMemBytes
+
+	workerID = registerWithMaster()
+	go heartbeatLoop()
 
 	// Worker get started.
 	for {
@@ -93,9 +127,7 @@ func CallExample() {
 // returns false if something goes wrong.
 //
 func call(rpcname string, args interface{}, reply interface{}) bool {
-	// c, err := rpc.DialHTTP("tcp", "127.0.0.1"+":1234")
-	sockname := masterSock()
-	c, err := rpc.DialHTTP("unix", sockname)
+	c, err := workerTransport.Dial()
 	if err != nil {
 		os.Exit(0)
 		// log.Fatal("dialing:", err)
@@ -112,13 +144,56 @@ func call(rpcname string, args interface{}, reply interface{}) bool {
 }
 
 func getTaskFromMaster() Task {
-	args := TaskReq{}
+	args := TaskReq{WorkerID: workerID}
 	reply := Task{}
 	call("Master.AssignTask", &args, &reply)
 	return reply
 }
 
+// registerWithMaster gets this process its WorkerID, which every later
+// AssignTask/Heartbeat call carries.
+func registerWithMaster() WorkerID {
+	args := RegisterArgs{}
+	reply := RegisterReply{}
+	call("Master.RegisterWorker", &args, &reply)
+	return reply.WorkerID
+}
+
+// heartbeatLoop renews this worker's lease every heartbeatInterval and
+// exits the process as soon as the master reports the job is done,
+// instead of waiting to notice AssignTask returning Exit.
+func heartbeatLoop() {
+	for {
+		time.Sleep(heartbeatInterval)
+		workerTaskMu.Lock()
+		tasks := append([]int(nil), workerCurrentTasks...)
+		workerTaskMu.Unlock()
+		args := HeartbeatArgs{WorkerID: workerID, TaskIds: tasks}
+		reply := HeartbeatReply{}
+		call("Master.Heartbeat", &args, &reply)
+		if reply.Exit {
+			os.Exit(0)
+		}
+	}
+}
+
+// setCurrentTask/clearCurrentTask record what this worker is holding so
+// heartbeatLoop can report accurate progress.
+func setCurrentTask(id int) {
+	workerTaskMu.Lock()
+	workerCurrentTasks = []int{id}
+	workerTaskMu.Unlock()
+}
+
+func clearCurrentTask() {
+	workerTaskMu.Lock()
+	workerCurrentTasks = nil
+	workerTaskMu.Unlock()
+}
+
 func mapper(task *Task, mapf func(string, string) []KeyValue) {
+	setCurrentTask(task.Id)
+	defer clearCurrentTask()
 	// Read from the file of the task.
 	content, err := ioutil.ReadFile(task.Input)
 	if err != nil {
@@ -129,44 +204,112 @@ func mapper(task *Task, mapf func(string, string) []KeyValue) {
 	
 	buffer := make([][]KeyValue, task.NReducer)
 	for _, intermediate := range intermediates {
-		slot := ihash(intermediate.Key) % task.NReducer
+		slot := workerPartition(intermediate.Key, task.NReducer)
 		buffer[slot] = append(buffer[slot], intermediate)
 	}
-	
+
+	if workerCombine != nil {
+		for i := range buffer {
+			buffer[i] = combine(buffer[i], workerCombine)
+		}
+	}
+
 	// Cache the result in local disk.
-	// The list of local files. 
+	// The list of local files.
 	mapOutput := make([]string, 0) // [mr-MapId-1, mr-MapId-2, ... , mr-MapId-NReduce]
 	for i := 0; i < task.NReducer; i++ {
 		mapOutput = append(mapOutput, writeToLocalFile(task.Id, i, &buffer[i]))
 	}
 
 	task.InterMediates = mapOutput
+	task.MapData = buffer
 	taskCompleted(task)
 }
 
-func reducer(task *Task, reducef func(string, []string) string) {
-	intermediate := *readFromLocalFile(task.InterMediates)
-	sort.Sort(ByKey(intermediate))
-	dir, _ := os.Getwd()
-	tempFile, err := ioutil.TempFile(dir, "mr-tmp-*")
-	if err != nil {
-		log.Fatal("Failed to create temp file: ", err)
-	}
+// combine groups kvs by key and folds each group's values through
+// combinef, so the mapper writes one KeyValue per key instead of one
+// per emitted pair. This is what shrinks intermediate file size and
+// shuffle I/O for aggregations like word count.
+func combine(kvs []KeyValue, combinef func(string, []string) string) []KeyValue {
+	sort.Sort(ByKey(kvs))
+	combined := make([]KeyValue, 0, len(kvs))
 	i := 0
-	for i < len(intermediate) {
+	for i < len(kvs) {
 		j := i + 1
-		for j < len(intermediate) && intermediate[j].Key == intermediate[j-1].Key {
+		for j < len(kvs) && kvs[j].Key == kvs[i].Key {
 			j++
 		}
-		values := []string{}
+		values := make([]string, 0, j-i)
 		for k := i; k < j; k++ {
-			values = append(values, intermediate[k].Value)
+			values = append(values, kvs[k].Value)
 		}
-		output := reducef(intermediate[i].Key, values)
-		fmt.Fprintf(tempFile, "%v %v\n", intermediate[i].Key, output)
+		combined = append(combined, KeyValue{Key: kvs[i].Key, Value: combinef(kvs[i].Key, values)})
 		i = j
 	}
+	return combined
+}
+
+// reducer never holds the whole partition in memory: it streams each
+// intermediate file through an in-memory run buffer, spilling a sorted
+// run to disk whenever the buffer passes maxReducerMemBytes, then does
+// an external k-way merge over the spill files (see external_sort.go).
+// That is what lets a single reducer handle a partition much larger
+// than RAM.
+func reducer(task *Task, reducef func(string, []string) string) {
+	setCurrentTask(task.Id)
+	defer clearCurrentTask()
+	dir, _ := os.Getwd()
+
+	var runPaths []string
+	var tail []KeyValue
+	var tailBytes int64
+	flushTail := func() {
+		if len(tail) == 0 {
+			return
+		}
+		runPaths = append(runPaths, spillRun(dir, tail))
+		tail = nil
+		tailBytes = 0
+	}
+
+	for _, path := range task.InterMediates {
+		it := readIntermediatePartition(path)
+		for {
+			kv, ok := it.next()
+			if !ok {
+				break
+			}
+			tail = append(tail, kv)
+			tailBytes += kvSize(kv)
+			if tailBytes >= maxReducerMemBytes {
+				flushTail()
+			}
+		}
+		it.close()
+	}
+
+	var sources []kvIterator
+	for _, p := range runPaths {
+		sources = append(sources, newFileIterator(p))
+	}
+	if len(tail) > 0 {
+		sort.Sort(ByKey(tail))
+		sources = append(sources, &sliceIterator{kvs: tail})
+	}
+
+	tempFile, err := ioutil.TempFile(dir, "mr-tmp-*")
+	if err != nil {
+		log.Fatal("Failed to create temp file: ", err)
+	}
+	externalMergeReduce(sources, reducef, tempFile)
 	tempFile.Close()
+	for _, src := range sources {
+		src.close()
+	}
+	for _, p := range runPaths {
+		os.Remove(p)
+	}
+
 	oname := fmt.Sprintf("mr-out-%d", task.Id)
 	os.Rename(tempFile.Name(), oname)
 	task.Output = oname
@@ -193,22 +336,75 @@ func writeToLocalFile(MapId, reduceId int, kvs *[]KeyValue) string {
 	return filepath.Join(dir, outputName)
 }
 
-func readFromLocalFile(files []string) *[]KeyValue {
-	// log.Println("read from local file: ", files)
-	kva := []KeyValue{}
-	for _, filepath := range files {
-		file, err := os.Open(filepath)
-		if err != nil {
-			log.Fatal("Failed to open file " + filepath, err)
+// readIntermediatePartition reads one mapper's contribution to a reduce
+// task's partition. When path happens to exist on this machine (the
+// single-process lab setup, or a reducer co-located with the mapper
+// that produced it) it is read directly; otherwise it is pulled, one
+// bounded chunk at a time, from the master's FetchIntermediate RPC,
+// which is what lets mappers and reducers run on machines that don't
+// share a filesystem without the reducer holding a remote partition in
+// memory at once (the master itself keeps every partition in
+// InterMediateCache).
+func readIntermediatePartition(path string) kvIterator {
+	if _, err := os.Stat(path); err == nil {
+		return &sliceIterator{kvs: *readLocalIntermediate(path)}
+	}
+	var mapId, reduceId int
+	fmt.Sscanf(filepath.Base(path), "mr-%d-%d", &mapId, &reduceId)
+	return &remoteIntermediateIterator{mapId: mapId, reduceId: reduceId}
+}
+
+// remoteIntermediateIterator pulls a remote mapper's partition through
+// FetchIntermediate one fetchChunkKVs-sized chunk at a time, so a
+// reducer never needs the whole partition in flight or in memory at
+// once just to read it off another machine.
+type remoteIntermediateIterator struct {
+	mapId, reduceId int
+	offset          int
+	buf             []KeyValue
+	idx             int
+	done            bool
+}
+
+func (it *remoteIntermediateIterator) next() (KeyValue, bool) {
+	if it.idx >= len(it.buf) {
+		if it.done {
+			return KeyValue{}, false
 		}
-		dec := json.NewDecoder(file)
-		for {
-			var kv KeyValue
-			if err := dec.Decode(&kv); err != nil {
-				break
-			}
-			kva = append(kva, kv)
+		args := FetchArgs{MapId: it.mapId, ReduceId: it.reduceId, Offset: it.offset}
+		reply := FetchReply{}
+		call("Master.FetchIntermediate", &args, &reply)
+		it.buf = reply.KVs
+		it.idx = 0
+		it.offset += len(reply.KVs)
+		it.done = reply.Done
+		if len(it.buf) == 0 {
+			return KeyValue{}, false
+		}
+	}
+	kv := it.buf[it.idx]
+	it.idx++
+	return kv, true
+}
+
+func (it *remoteIntermediateIterator) close() {}
+
+// readLocalIntermediate reads one mapper's partition file off local
+// disk. FetchIntermediate does not use it: the master serves remote
+// reducers out of InterMediateCache instead.
+func readLocalIntermediate(path string) *[]KeyValue {
+	kva := []KeyValue{}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal("Failed to open file "+path, err)
+	}
+	dec := json.NewDecoder(file)
+	for {
+		var kv KeyValue
+		if err := dec.Decode(&kv); err != nil {
+			break
 		}
+		kva = append(kva, kv)
 	}
 	return &kva
 }